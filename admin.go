@@ -0,0 +1,98 @@
+package plugin_simplecache
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// methodPurge is the non-standard HTTP method used to invalidate cache
+// entries and tags through the admin endpoint.
+const methodPurge = "PURGE"
+
+// handleAdmin serves the plugin's own purge/stats endpoint, mounted under
+// c.adminPath, and reports whether it handled req. It's a no-op when no
+// admin path is configured.
+func (c *Cache) handleAdmin(rw http.ResponseWriter, req *http.Request) bool {
+	if c.adminPath == "" || !strings.HasPrefix(req.URL.Path, c.adminPath+"/") {
+		return false
+	}
+
+	if !c.adminAuthorized(req) {
+		http.Error(rw, "unauthorized", http.StatusUnauthorized)
+		return true
+	}
+
+	rest := strings.TrimPrefix(req.URL.Path, c.adminPath)
+
+	switch {
+	case req.Method == http.MethodGet && rest == "/stats":
+		c.writeStats(rw)
+	case req.Method == methodPurge && strings.HasPrefix(rest, "/keys/"):
+		c.purgeKey(strings.TrimPrefix(rest, "/keys/"))
+		rw.WriteHeader(http.StatusNoContent)
+	case req.Method == methodPurge && strings.HasPrefix(rest, "/tags/"):
+		c.purgeTag(strings.TrimPrefix(rest, "/tags/"))
+		rw.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(rw, req)
+	}
+
+	return true
+}
+
+func (c *Cache) adminAuthorized(req *http.Request) bool {
+	if c.adminToken == "" {
+		return true
+	}
+
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(c.adminToken)) == 1
+}
+
+// writeStats responds with hit/miss counters and the number of live entries.
+func (c *Cache) writeStats(rw http.ResponseWriter) {
+	var entries int64
+	_ = c.store.Iterate(func(key string, e *entry) bool {
+		if !isVaryRecordKey(key) {
+			entries++
+		}
+		return true
+	})
+
+	body := c.stats.snapshot()
+	body["entries"] = entries
+
+	rw.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(rw).Encode(body)
+}
+
+// purgeKey deletes the entry stored for key, along with any Vary-aware
+// sub-entries recorded under it (stored as "<key>|vary|..."), via
+// Storage.Purge so a single invalidation catches every variant.
+func (c *Cache) purgeKey(key string) {
+	_ = c.store.Delete(key)
+	_ = c.store.Purge(key + "|vary|")
+}
+
+// purgeTag deletes every entry tagged with tag, as set from the configured
+// surrogate-key response header.
+func (c *Cache) purgeTag(tag string) {
+	var keys []string
+
+	_ = c.store.Iterate(func(key string, e *entry) bool {
+		for _, t := range e.Tags {
+			if t == tag {
+				keys = append(keys, key)
+				break
+			}
+		}
+		return true
+	})
+
+	for _, key := range keys {
+		_ = c.store.Delete(key)
+	}
+}
@@ -0,0 +1,562 @@
+// Package plugin_simplecache implements a Traefik middleware plugin that
+// caches upstream responses, on disk by default or in memory, following
+// RFC 7234 cache-control semantics.
+package plugin_simplecache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const cacheHeader = "Cache-Status"
+
+// defaultMaxPostBodyBytes bounds how much of a POST body is buffered to
+// compute its cache key when Config.MaxPostBodyBytes isn't set.
+const defaultMaxPostBodyBytes = 64 * 1024
+
+func methodSet(methods []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(methods))
+	for _, m := range methods {
+		set[strings.ToUpper(m)] = struct{}{}
+	}
+
+	return set
+}
+
+func (c *Cache) methodCacheable(method string) bool {
+	_, ok := c.cacheableMethods[method]
+	return ok
+}
+
+// Cache is a Traefik middleware that caches responses from next.
+type Cache struct {
+	next http.Handler
+	name string
+
+	store     Storage
+	maxExpiry time.Duration
+
+	addStatusHeader  bool
+	considerUrlQuery bool
+
+	keyTemplate       string
+	ignoreQueryParams []string
+	allowQueryParams  []string
+
+	surrogateKeyHeader string
+	adminPath          string
+	adminToken         string
+
+	cacheableMethods map[string]struct{}
+	maxPostBodyBytes int64
+	enableETag       bool
+
+	refreshMu  sync.Mutex
+	refreshing map[string]struct{}
+
+	stats cacheStats
+}
+
+// New creates and returns a new Cache plugin instance.
+func New(ctx context.Context, next http.Handler, cfg *Config, name string) (http.Handler, error) {
+	if cfg.MaxExpiry <= 1 {
+		return nil, errors.New("maxExpiry must be greater than 1")
+	}
+
+	if cfg.Cleanup <= 1 {
+		return nil, errors.New("cleanup must be greater than 1")
+	}
+
+	store, err := newStorage(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating storage: %w", err)
+	}
+
+	surrogateKeyHeader := cfg.SurrogateKeyHeader
+	if surrogateKeyHeader == "" {
+		surrogateKeyHeader = "Surrogate-Key"
+	}
+
+	cacheableMethods := cfg.CacheableMethods
+	if len(cacheableMethods) == 0 {
+		cacheableMethods = []string{http.MethodGet, http.MethodHead}
+	}
+
+	maxPostBodyBytes := cfg.MaxPostBodyBytes
+	if maxPostBodyBytes <= 0 {
+		maxPostBodyBytes = defaultMaxPostBodyBytes
+	}
+
+	c := &Cache{
+		next:               next,
+		name:               name,
+		store:              store,
+		maxExpiry:          time.Duration(cfg.MaxExpiry) * time.Second,
+		addStatusHeader:    cfg.AddStatusHeader,
+		considerUrlQuery:   cfg.ConsiderUrlQuery,
+		keyTemplate:        cfg.CacheKey,
+		ignoreQueryParams:  cfg.IgnoreQueryParams,
+		allowQueryParams:   cfg.AllowQueryParams,
+		surrogateKeyHeader: surrogateKeyHeader,
+		adminPath:          strings.TrimSuffix(cfg.Admin.Path, "/"),
+		adminToken:         cfg.Admin.Token,
+		cacheableMethods:   methodSet(cacheableMethods),
+		maxPostBodyBytes:   maxPostBodyBytes,
+		enableETag:         cfg.EnableETag,
+		refreshing:         make(map[string]struct{}),
+	}
+
+	go c.cleanupLoop(ctx, time.Duration(cfg.Cleanup)*time.Second)
+
+	return c, nil
+}
+
+// expirySweeper is implemented by storage backends that need periodic
+// sweeping of entries gone stale beyond any use. Both backends offered here
+// (file and memory) implement it; cleanupLoop returns at once for a backend
+// that doesn't.
+type expirySweeper interface {
+	cleanupExpired(maxExpiry time.Duration) error
+}
+
+func (c *Cache) cleanupLoop(ctx context.Context, interval time.Duration) {
+	sweeper, ok := c.store.(expirySweeper)
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = sweeper.cleanupExpired(c.maxExpiry)
+		}
+	}
+}
+
+// ServeHTTP decides, for each request, whether a stored response can be
+// served as-is, must be revalidated with next, or whether next must be
+// called outright, then stores whatever is cacheable from the result.
+func (c *Cache) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if c.handleAdmin(rw, req) {
+		return
+	}
+
+	if !c.methodCacheable(req.Method) {
+		c.next.ServeHTTP(rw, req)
+		return
+	}
+
+	isHead := req.Method == http.MethodHead
+
+	lookupMethod := req.Method
+	if isHead {
+		// HEAD shares GET's cache entry; only GET ever stores one.
+		lookupMethod = http.MethodGet
+	}
+
+	base := c.cacheKeyMethod(req, lookupMethod)
+
+	if req.Method == http.MethodPost {
+		hash, cacheable := c.capturePostBody(req)
+		if !cacheable {
+			c.next.ServeHTTP(rw, req)
+			return
+		}
+		base += "|body:" + hash
+	}
+
+	key := varyActualKey(base, c.lookupVaryNames(base), req.Header)
+	reqCC := parseCacheControl(req.Header.Get("Cache-Control"))
+	if req.Header.Get("Cache-Control") == "" && pragmaNoCache(req.Header.Get("Pragma")) {
+		reqCC.NoCache = true
+	}
+
+	e, ok := c.store.Get(key)
+	if ok && !reqCC.NoStore {
+		age := currentAge(e)
+		life := freshnessLifetime(e, c.maxExpiry)
+		fresh := age <= life
+
+		if fresh && reqCC.MinFresh >= 0 {
+			fresh = life-age >= time.Duration(reqCC.MinFresh)*time.Second
+		}
+
+		if !fresh && reqCC.MaxStaleSet && !e.MustRevalidate {
+			fresh = age-life <= time.Duration(reqCC.MaxStale)*time.Second
+		}
+
+		if fresh && !reqCC.NoCache && !e.NoCache {
+			c.serveEntry(rw, req, e, age, "hit")
+			return
+		}
+
+		if !reqCC.NoCache && !e.MustRevalidate && e.StaleWhileRevalidate >= 0 &&
+			age <= life+time.Duration(e.StaleWhileRevalidate)*time.Second {
+			c.serveEntry(rw, req, e, age, "hit; stale")
+			if !isHead {
+				c.backgroundRefresh(req, base, key)
+			}
+			return
+		}
+
+		rec := c.fetchConditional(req, e)
+
+		if rec.status == http.StatusNotModified {
+			refreshed := refreshEntry(e, rec)
+			_ = c.store.Set(key, refreshed)
+			c.serveEntry(rw, req, refreshed, currentAge(refreshed), "revalidated")
+			return
+		}
+
+		if rec.status >= http.StatusInternalServerError && !e.MustRevalidate && e.StaleIfError >= 0 &&
+			age <= life+time.Duration(e.StaleIfError)*time.Second {
+			rw.Header().Set("Warning", `110 - "Response is Stale"`)
+			c.serveEntry(rw, req, e, age, "hit; stale")
+			return
+		}
+
+		if isHead {
+			c.stats.record("miss")
+			writeRecorder(rw, rec)
+			return
+		}
+
+		c.writeAndStore(rw, rec, base, req, reqCC.NoStore, "miss")
+		return
+	}
+
+	rec := c.fetchConditional(req, nil)
+
+	if isHead {
+		c.stats.record("miss")
+		writeRecorder(rw, rec)
+		return
+	}
+
+	c.writeAndStore(rw, rec, base, req, reqCC.NoStore, "miss")
+}
+
+// serveEntry writes a stored entry to rw, adding Age and the Cache-Status
+// header. It omits the body for HEAD requests, per RFC 7231 Section 4.3.2,
+// even though HEAD reuses GET's entry. If req itself carries a matching
+// If-None-Match or If-Modified-Since, it's answered with 304 straight from
+// the stored validators, without involving next.
+func (c *Cache) serveEntry(rw http.ResponseWriter, req *http.Request, e *entry, age time.Duration, status string) {
+	c.stats.record(status)
+
+	header := rw.Header()
+	for k, values := range e.Header {
+		for _, v := range values {
+			header.Add(k, v)
+		}
+	}
+
+	header.Set("Age", strconv.Itoa(int(age.Seconds())))
+
+	if c.addStatusHeader {
+		header.Set(cacheHeader, status)
+	}
+
+	if conditionalHit(req, e) {
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	rw.WriteHeader(e.StatusCode)
+
+	if req.Method != http.MethodHead {
+		_, _ = rw.Write(e.Body)
+	}
+}
+
+// writeRecorder copies a recorded response straight through to rw, without
+// storing it. Used for HEAD misses, which must never be cached under GET's
+// key.
+func writeRecorder(rw http.ResponseWriter, rec *responseRecorder) {
+	header := rw.Header()
+	for k, values := range rec.header {
+		header[k] = values
+	}
+
+	rw.WriteHeader(rec.status)
+}
+
+// capturePostBody buffers req's body, replacing it with an equivalent reader
+// so next still observes the full stream, and reports a hex-encoded hash of
+// it along with whether the body was short enough to cache at all. Bodies
+// over c.maxPostBodyBytes are left untouched and reported uncacheable.
+func (c *Cache) capturePostBody(req *http.Request) (hash string, cacheable bool) {
+	if req.Body == nil {
+		return fmt.Sprintf("%x", sha256.Sum256(nil)), true
+	}
+
+	var buf bytes.Buffer
+	_, _ = io.Copy(&buf, io.LimitReader(req.Body, c.maxPostBodyBytes+1))
+
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf.Bytes()), req.Body), req.Body}
+
+	if int64(buf.Len()) > c.maxPostBodyBytes {
+		return "", false
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	return fmt.Sprintf("%x", sum), true
+}
+
+// fetchConditional calls next, adding If-None-Match / If-Modified-Since
+// headers derived from e's validators when e is non-nil.
+func (c *Cache) fetchConditional(req *http.Request, e *entry) *responseRecorder {
+	fetchReq := req
+
+	if e != nil && (e.ETag != "" || e.LastModified != "") {
+		fetchReq = req.Clone(req.Context())
+		fetchReq.Header.Del("If-None-Match")
+		fetchReq.Header.Del("If-Modified-Since")
+
+		if e.ETag != "" {
+			fetchReq.Header.Set("If-None-Match", e.ETag)
+		}
+
+		if e.LastModified != "" {
+			fetchReq.Header.Set("If-Modified-Since", e.LastModified)
+		}
+	}
+
+	rec := newResponseRecorder()
+	c.next.ServeHTTP(rec, fetchReq)
+
+	return rec
+}
+
+// refreshEntry merges a 304 response's headers into the stored entry it
+// revalidates, resetting its age-tracking fields.
+func refreshEntry(e *entry, rec *responseRecorder) *entry {
+	refreshed := *e
+	refreshed.Header = e.Header.Clone()
+	for k, values := range rec.header {
+		refreshed.Header[k] = values
+	}
+	refreshed.Date = responseDate(rec.header)
+	refreshed.StoredAt = time.Now()
+	refreshed.InitialAge = parseAge(rec.header.Get("Age"))
+
+	return &refreshed
+}
+
+// backgroundRefresh re-fetches base from next in the background, replacing
+// the stored entry if the response is cacheable. At most one refresh per
+// resolved lookup key (i.e. per Vary variant) is ever in flight; base is
+// only needed to re-derive the store key once the fresh response's own
+// Vary header is known.
+func (c *Cache) backgroundRefresh(req *http.Request, base, key string) {
+	c.refreshMu.Lock()
+	if _, inFlight := c.refreshing[key]; inFlight {
+		c.refreshMu.Unlock()
+		return
+	}
+	c.refreshing[key] = struct{}{}
+	c.refreshMu.Unlock()
+
+	refreshReq := req.Clone(context.Background())
+
+	go func() {
+		defer func() {
+			c.refreshMu.Lock()
+			delete(c.refreshing, key)
+			c.refreshMu.Unlock()
+		}()
+
+		rec := newResponseRecorder()
+		c.next.ServeHTTP(rec, refreshReq)
+
+		if e := buildEntry(refreshReq.Method, rec, c.surrogateKeyHeader, c.enableETag); e != nil {
+			key := c.resolveStoreKey(base, refreshReq, rec.header.Get("Vary"))
+			_ = c.store.Set(key, e)
+		}
+	}()
+}
+
+// writeAndStore stores rec's response under the key derived from base and
+// its own Vary header, if cacheable, then writes it to rw as-is. reqNoStore
+// carries the request's own Cache-Control: no-store, which per RFC 7234
+// Section 5.2.1.5 forbids storing any part of the response regardless of
+// what the response itself allows.
+func (c *Cache) writeAndStore(rw http.ResponseWriter, rec *responseRecorder, base string, req *http.Request, reqNoStore bool, status string) {
+	c.stats.record(status)
+
+	if !reqNoStore {
+		if e := buildEntry(req.Method, rec, c.surrogateKeyHeader, c.enableETag); e != nil {
+			key := c.resolveStoreKey(base, req, rec.header.Get("Vary"))
+			_ = c.store.Set(key, e)
+		}
+	}
+
+	header := rw.Header()
+	for k, values := range rec.header {
+		header[k] = values
+	}
+
+	if c.addStatusHeader {
+		header.Set(cacheHeader, status)
+	}
+
+	rw.WriteHeader(rec.status)
+	_, _ = rw.Write(rec.body.Bytes())
+}
+
+// buildEntry turns a recorded response into a storable entry, or nil if the
+// response isn't cacheable for method. surrogateKeyHeader names the response
+// header listing the tags the entry should be purgeable by. When enableETag
+// is set and the response didn't send its own ETag, one is synthesized from
+// the body so later hits can be revalidated without involving next.
+func buildEntry(method string, rec *responseRecorder, surrogateKeyHeader string, enableETag bool) *entry {
+	respCC := parseCacheControl(rec.header.Get("Cache-Control"))
+	if !isCacheable(method, rec.status, respCC) || varyIsWildcard(rec.header.Get("Vary")) {
+		return nil
+	}
+
+	if enableETag && rec.header.Get("ETag") == "" {
+		rec.header.Set("ETag", synthesizeETag(rec.body.Bytes()))
+	}
+
+	return &entry{
+		StatusCode:           rec.status,
+		Header:               rec.header,
+		Body:                 rec.body.Bytes(),
+		Date:                 responseDate(rec.header),
+		StoredAt:             time.Now(),
+		InitialAge:           parseAge(rec.header.Get("Age")),
+		MaxAge:               respCC.MaxAge,
+		SMaxAge:              respCC.SMaxAge,
+		NoCache:              respCC.NoCache,
+		MustRevalidate:       respCC.MustRevalidate,
+		Expires:              parseHTTPDate(rec.header.Get("Expires")),
+		StaleWhileRevalidate: respCC.StaleWhileRevalidate,
+		StaleIfError:         respCC.StaleIfError,
+		Tags:                 strings.Fields(rec.header.Get(surrogateKeyHeader)),
+		ETag:                 rec.header.Get("ETag"),
+		LastModified:         rec.header.Get("Last-Modified"),
+		Vary:                 rec.header.Get("Vary"),
+	}
+}
+
+// isCacheable reports whether a response to method may be stored at all, per
+// its status code and the response's own Cache-Control directives. POST
+// responses are held to a stricter policy than GET/HEAD: since caching a
+// POST is unusual enough to surprise callers, it's only allowed when the
+// response explicitly opts in with "public" and an explicit max-age.
+func isCacheable(method string, status int, cc cacheControl) bool {
+	if cc.NoStore || cc.Private {
+		return false
+	}
+
+	if method == http.MethodPost {
+		return cc.Public && cc.MaxAge >= 0 && status == http.StatusOK
+	}
+
+	switch status {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent,
+		http.StatusPartialContent, http.StatusMultipleChoices, http.StatusMovedPermanently,
+		http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusGone, http.StatusRequestURITooLong:
+		return true
+	}
+
+	return false
+}
+
+// freshnessLifetime computes how long a stored entry is considered fresh,
+// per RFC 7234 Section 4.2.1, falling back to maxExpiry when the response
+// gave no explicit freshness information.
+func freshnessLifetime(e *entry, maxExpiry time.Duration) time.Duration {
+	if e.SMaxAge >= 0 {
+		return time.Duration(e.SMaxAge) * time.Second
+	}
+
+	if e.MaxAge >= 0 {
+		return time.Duration(e.MaxAge) * time.Second
+	}
+
+	if !e.Expires.IsZero() {
+		if d := e.Expires.Sub(e.Date); d > 0 {
+			return d
+		}
+
+		return 0
+	}
+
+	return maxExpiry
+}
+
+// staleExtension returns the longest of an entry's stale-while-revalidate
+// and stale-if-error windows, used to decide how long past its freshness
+// lifetime a stale entry is still worth keeping around.
+func staleExtension(e *entry) time.Duration {
+	d := time.Duration(0)
+	if e.StaleWhileRevalidate > 0 {
+		d = time.Duration(e.StaleWhileRevalidate) * time.Second
+	}
+	if e.StaleIfError > 0 {
+		if sie := time.Duration(e.StaleIfError) * time.Second; sie > d {
+			d = sie
+		}
+	}
+	return d
+}
+
+// currentAge computes the age of a stored entry per RFC 7234 Section 4.2.3,
+// simplified to the local-clock terms that apply to a single-hop cache.
+func currentAge(e *entry) time.Duration {
+	return time.Since(e.StoredAt) + time.Duration(e.InitialAge)*time.Second
+}
+
+func parseAge(value string) int {
+	if value == "" {
+		return 0
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+
+	return seconds
+}
+
+func responseDate(header http.Header) time.Time {
+	if d := parseHTTPDate(header.Get("Date")); !d.IsZero() {
+		return d
+	}
+
+	return time.Now()
+}
+
+func parseHTTPDate(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
+
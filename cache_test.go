@@ -1,12 +1,15 @@
 package plugin_simplecache
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -92,6 +95,144 @@ func TestCache_ServeHTTP(t *testing.T) {
 
 }
 
+func TestCache_ServeHTTP_RequestNoStore(t *testing.T) {
+	dir := createTempDir(t)
+
+	calls := 0
+	next := func(rw http.ResponseWriter, req *http.Request) {
+		calls++
+		rw.Header().Set("Cache-Control", "max-age=60")
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	cfg := &Config{Path: dir, MaxExpiry: 300, Cleanup: 600, AddStatusHeader: true}
+
+	c, err := New(context.Background(), http.HandlerFunc(next), cfg, "simplecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/no-store", nil)
+	req.Header.Set("Cache-Control", "no-store")
+
+	rw := httptest.NewRecorder()
+	c.ServeHTTP(rw, req)
+
+	if state := rw.Header().Get("Cache-Status"); state != "miss" {
+		t.Fatalf("unexpected cache state: want \"miss\", got: %q", state)
+	}
+
+	// The request's own Cache-Control: no-store must stop the response
+	// from being stored at all (RFC 7234 Section 5.2.1.5), so a later
+	// plain GET for the same URL should still miss.
+	rw = httptest.NewRecorder()
+	c.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://localhost/no-store", nil))
+
+	if state := rw.Header().Get("Cache-Status"); state != "miss" {
+		t.Errorf("response was stored despite request Cache-Control: no-store (state %q)", state)
+	}
+
+	if calls != 2 {
+		t.Errorf("expected next to be called twice, got %d", calls)
+	}
+}
+
+func TestCache_ServeHTTP_MustRevalidateStaleWhileRevalidate(t *testing.T) {
+	dir := createTempDir(t)
+
+	calls := 0
+	next := func(rw http.ResponseWriter, req *http.Request) {
+		calls++
+		rw.Header().Set("Cache-Control", "max-age=60, must-revalidate, stale-while-revalidate=60")
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	cfg := &Config{Path: dir, MaxExpiry: 300, Cleanup: 600, AddStatusHeader: true}
+
+	h, err := New(context.Background(), http.HandlerFunc(next), cfg, "simplecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := h.(*Cache)
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/must-revalidate-swr", nil)
+	c.ServeHTTP(httptest.NewRecorder(), req)
+
+	key := c.cacheKey(req)
+	e, ok := c.store.Get(key)
+	if !ok {
+		t.Fatal("expected entry to be stored")
+	}
+
+	// Stale beyond the 60s max-age, but still within the 60s
+	// stale-while-revalidate window.
+	e.StoredAt = time.Now().Add(-90 * time.Second)
+	if err := c.store.Set(key, e); err != nil {
+		t.Fatal(err)
+	}
+
+	rw := httptest.NewRecorder()
+	c.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://localhost/must-revalidate-swr", nil))
+
+	if state := rw.Header().Get("Cache-Status"); state == "hit; stale" {
+		t.Errorf("must-revalidate entry was served stale via stale-while-revalidate")
+	}
+
+	if calls != 2 {
+		t.Errorf("expected next to be called to revalidate, got %d calls", calls)
+	}
+}
+
+func TestCache_ServeHTTP_MustRevalidateStaleIfError(t *testing.T) {
+	dir := createTempDir(t)
+
+	calls := 0
+	next := func(rw http.ResponseWriter, req *http.Request) {
+		calls++
+		if calls == 1 {
+			rw.Header().Set("Cache-Control", "max-age=60, must-revalidate, stale-if-error=60")
+			rw.WriteHeader(http.StatusOK)
+			return
+		}
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+
+	cfg := &Config{Path: dir, MaxExpiry: 300, Cleanup: 600, AddStatusHeader: true}
+
+	h, err := New(context.Background(), http.HandlerFunc(next), cfg, "simplecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := h.(*Cache)
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/must-revalidate-sie", nil)
+	c.ServeHTTP(httptest.NewRecorder(), req)
+
+	key := c.cacheKey(req)
+	e, ok := c.store.Get(key)
+	if !ok {
+		t.Fatal("expected entry to be stored")
+	}
+
+	// Stale beyond the 60s max-age, but still within the 60s
+	// stale-if-error window.
+	e.StoredAt = time.Now().Add(-90 * time.Second)
+	if err := c.store.Set(key, e); err != nil {
+		t.Fatal(err)
+	}
+
+	rw := httptest.NewRecorder()
+	c.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://localhost/must-revalidate-sie", nil))
+
+	if rw.Code != http.StatusInternalServerError {
+		t.Errorf("must-revalidate entry masked the upstream error via stale-if-error, got status %d", rw.Code)
+	}
+
+	if state := rw.Header().Get("Cache-Status"); state == "hit; stale" {
+		t.Errorf("must-revalidate entry was served stale via stale-if-error")
+	}
+}
+
 func TestCache_ServeHTTP_ConsiderUrlQuery(t *testing.T) {
 	dir := createTempDir(t)
 
@@ -132,6 +273,392 @@ func TestCache_ServeHTTP_ConsiderUrlQuery(t *testing.T) {
 	}
 }
 
+func TestCache_ServeHTTP_VaryAwareSubEntries(t *testing.T) {
+	dir := createTempDir(t)
+
+	next := func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Cache-Control", "max-age=60")
+		rw.Header().Set("Vary", "Accept-Language")
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	cfg := &Config{Path: dir, MaxExpiry: 300, Cleanup: 600, AddStatusHeader: true}
+
+	c, err := New(context.Background(), http.HandlerFunc(next), cfg, "simplecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reqEN := httptest.NewRequest(http.MethodGet, "http://localhost/vary-lang", nil)
+	reqEN.Header.Set("Accept-Language", "en")
+	rw := httptest.NewRecorder()
+	c.ServeHTTP(rw, reqEN)
+
+	if state := rw.Header().Get("Cache-Status"); state != "miss" {
+		t.Fatalf("unexpected cache state: want \"miss\", got: %q", state)
+	}
+
+	reqFR := httptest.NewRequest(http.MethodGet, "http://localhost/vary-lang", nil)
+	reqFR.Header.Set("Accept-Language", "fr")
+	rw = httptest.NewRecorder()
+	c.ServeHTTP(rw, reqFR)
+
+	if state := rw.Header().Get("Cache-Status"); state != "miss" {
+		t.Errorf("unexpected cache state for a different Vary header value: want \"miss\", got: %q", state)
+	}
+
+	rw = httptest.NewRecorder()
+	c.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://localhost/vary-lang", nil))
+
+	if state := rw.Header().Get("Cache-Status"); state != "miss" {
+		t.Errorf("unexpected cache state for an absent Vary header value: want \"miss\", got: %q", state)
+	}
+
+	rw = httptest.NewRecorder()
+	c.ServeHTTP(rw, reqEN)
+
+	if state := rw.Header().Get("Cache-Status"); state != "hit" {
+		t.Errorf("unexpected cache state for a repeated Vary header value: want \"hit\", got: %q", state)
+	}
+}
+
+func TestCache_CleanupExpired_PreservesVaryMarker(t *testing.T) {
+	dir := createTempDir(t)
+
+	next := func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Cache-Control", "max-age=60")
+		rw.Header().Set("Vary", "Accept-Language")
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	cfg := &Config{Path: dir, MaxExpiry: 300, Cleanup: 600, AddStatusHeader: true}
+
+	h, err := New(context.Background(), http.HandlerFunc(next), cfg, "simplecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := h.(*Cache)
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/vary-cleanup", nil)
+	req.Header.Set("Accept-Language", "en")
+	c.ServeHTTP(httptest.NewRecorder(), req)
+
+	base := c.cacheKey(req)
+	if names := c.lookupVaryNames(base); len(names) == 0 {
+		t.Fatal("expected the Vary marker to be recorded")
+	}
+
+	sweeper, ok := c.store.(expirySweeper)
+	if !ok {
+		t.Fatal("file store does not implement expirySweeper")
+	}
+	if err := sweeper.cleanupExpired(c.maxExpiry); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := c.lookupVaryNames(base); len(names) == 0 {
+		t.Fatal("cleanupExpired deleted the Vary marker")
+	}
+
+	rw := httptest.NewRecorder()
+	c.ServeHTTP(rw, req)
+
+	if state := rw.Header().Get("Cache-Status"); state != "hit" {
+		t.Errorf("losing the Vary marker forced an avoidable miss: want \"hit\", got: %q", state)
+	}
+}
+
+func TestCache_ServeHTTP_BackgroundRefreshPerVaryVariant(t *testing.T) {
+	dir := createTempDir(t)
+
+	var calls int32
+	refreshed := make(chan string, 2)
+	release := make(chan struct{})
+
+	next := func(rw http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		rw.Header().Set("Cache-Control", "max-age=1, stale-while-revalidate=60")
+		rw.Header().Set("Vary", "Accept-Language")
+		rw.WriteHeader(http.StatusOK)
+
+		if n > 2 { // a background refresh of an already-served variant
+			refreshed <- req.Header.Get("Accept-Language")
+			<-release
+		}
+	}
+
+	cfg := &Config{Path: dir, MaxExpiry: 300, Cleanup: 600, AddStatusHeader: true}
+
+	h, err := New(context.Background(), http.HandlerFunc(next), cfg, "simplecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := h.(*Cache)
+
+	reqEN := httptest.NewRequest(http.MethodGet, "http://localhost/refresh-vary", nil)
+	reqEN.Header.Set("Accept-Language", "en")
+	c.ServeHTTP(httptest.NewRecorder(), reqEN)
+
+	reqFR := httptest.NewRequest(http.MethodGet, "http://localhost/refresh-vary", nil)
+	reqFR.Header.Set("Accept-Language", "fr")
+	c.ServeHTTP(httptest.NewRecorder(), reqFR)
+
+	// Make both variants stale but still within their
+	// stale-while-revalidate window, so both trigger a background refresh.
+	base := c.cacheKey(reqEN)
+	for _, req := range []*http.Request{reqEN, reqFR} {
+		key := varyActualKey(base, []string{"Accept-Language"}, req.Header)
+		e, ok := c.store.Get(key)
+		if !ok {
+			t.Fatal("expected entry to be stored")
+		}
+		e.StoredAt = time.Now().Add(-2 * time.Second)
+		if err := c.store.Set(key, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.ServeHTTP(httptest.NewRecorder(), reqEN)
+	c.ServeHTTP(httptest.NewRecorder(), reqFR)
+
+	seen := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case lang := <-refreshed:
+			seen[lang] = true
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for background refreshes, got %v", seen)
+		}
+	}
+	close(release)
+
+	if !seen["en"] || !seen["fr"] {
+		t.Errorf("expected both Vary variants to refresh in the background, got %v", seen)
+	}
+
+	// Let the background goroutines finish storing before the test's
+	// temp-dir cleanup runs, so it doesn't race with their writes.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		c.refreshMu.Lock()
+		inFlight := len(c.refreshing)
+		c.refreshMu.Unlock()
+
+		if inFlight == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for background refreshes to finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCache_ServeHTTP_HeadSharesGetEntry(t *testing.T) {
+	dir := createTempDir(t)
+
+	next := func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Cache-Control", "max-age=60")
+		rw.WriteHeader(http.StatusOK)
+		if req.Method != http.MethodHead {
+			_, _ = rw.Write([]byte("body"))
+		}
+	}
+
+	cfg := &Config{Path: dir, MaxExpiry: 300, Cleanup: 600, AddStatusHeader: true}
+
+	c, err := New(context.Background(), http.HandlerFunc(next), cfg, "simplecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getReq := httptest.NewRequest(http.MethodGet, "http://localhost/head-shared", nil)
+	rw := httptest.NewRecorder()
+	c.ServeHTTP(rw, getReq)
+
+	if state := rw.Header().Get("Cache-Status"); state != "miss" {
+		t.Fatalf("unexpected cache state: want \"miss\", got: %q", state)
+	}
+
+	headReq := httptest.NewRequest(http.MethodHead, "http://localhost/head-shared", nil)
+	rw = httptest.NewRecorder()
+	c.ServeHTTP(rw, headReq)
+
+	if state := rw.Header().Get("Cache-Status"); state != "hit" {
+		t.Errorf("HEAD did not reuse GET's cache entry: want \"hit\", got: %q", state)
+	}
+
+	if rw.Body.Len() != 0 {
+		t.Errorf("HEAD response unexpectedly carried a body: %q", rw.Body.String())
+	}
+}
+
+func TestCache_ServeHTTP_CacheablePost(t *testing.T) {
+	dir := createTempDir(t)
+
+	calls := 0
+	next := func(rw http.ResponseWriter, req *http.Request) {
+		calls++
+		rw.Header().Set("Cache-Control", "public, max-age=60")
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	cfg := &Config{
+		Path: dir, MaxExpiry: 300, Cleanup: 600, AddStatusHeader: true,
+		CacheableMethods: []string{http.MethodGet, http.MethodHead, http.MethodPost},
+	}
+
+	c, err := New(context.Background(), http.HandlerFunc(next), cfg, "simplecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte(`{"query":"same"}`)
+
+	rw := httptest.NewRecorder()
+	c.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "http://localhost/search", bytes.NewReader(body)))
+
+	if state := rw.Header().Get("Cache-Status"); state != "miss" {
+		t.Fatalf("unexpected cache state: want \"miss\", got: %q", state)
+	}
+
+	rw = httptest.NewRecorder()
+	c.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "http://localhost/search", bytes.NewReader(body)))
+
+	if state := rw.Header().Get("Cache-Status"); state != "hit" {
+		t.Errorf("unexpected cache state for a repeated POST body: want \"hit\", got: %q", state)
+	}
+
+	if calls != 1 {
+		t.Errorf("expected next to be called once, got %d", calls)
+	}
+}
+
+func TestCache_ServeHTTP_SynthesizedETagConditionalHit(t *testing.T) {
+	dir := createTempDir(t)
+
+	next := func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Cache-Control", "max-age=60")
+		rw.WriteHeader(http.StatusOK)
+		_, _ = rw.Write([]byte("same body"))
+	}
+
+	cfg := &Config{Path: dir, MaxExpiry: 300, Cleanup: 600, AddStatusHeader: true, EnableETag: true}
+
+	c, err := New(context.Background(), http.HandlerFunc(next), cfg, "simplecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rw := httptest.NewRecorder()
+	c.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://localhost/etag", nil))
+
+	etag := rw.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected a synthesized ETag")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/etag", nil)
+	req.Header.Set("If-None-Match", etag)
+
+	rw = httptest.NewRecorder()
+	c.ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusNotModified {
+		t.Errorf("expected 304 Not Modified from the synthesized ETag, got %d", rw.Code)
+	}
+}
+
+func TestCache_Admin_Stats(t *testing.T) {
+	dir := createTempDir(t)
+
+	next := func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Cache-Control", "max-age=60")
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	cfg := &Config{
+		Path: dir, MaxExpiry: 300, Cleanup: 600,
+		Admin: AdminConfig{Path: "/cache-admin"},
+	}
+
+	c, err := New(context.Background(), http.HandlerFunc(next), cfg, "simplecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/stats-me", nil)
+	c.ServeHTTP(httptest.NewRecorder(), req) // miss
+	c.ServeHTTP(httptest.NewRecorder(), req) // hit
+
+	rw := httptest.NewRecorder()
+	c.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://localhost/cache-admin/stats", nil))
+
+	if rw.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rw.Code)
+	}
+
+	var body map[string]float64
+	if err := json.NewDecoder(rw.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if body["hits"] != 1 {
+		t.Errorf("unexpected hits count: %v", body["hits"])
+	}
+
+	if body["misses"] != 1 {
+		t.Errorf("unexpected misses count: %v", body["misses"])
+	}
+
+	if body["entries"] != 1 {
+		t.Errorf("unexpected entries count: %v", body["entries"])
+	}
+}
+
+func TestCache_Admin_PurgeKeyRemovesVarySubEntries(t *testing.T) {
+	dir := createTempDir(t)
+
+	next := func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Cache-Control", "max-age=60")
+		rw.Header().Set("Vary", "Accept-Language")
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	cfg := &Config{
+		Path: dir, MaxExpiry: 300, Cleanup: 600, AddStatusHeader: true,
+		Admin: AdminConfig{Path: "/cache-admin"},
+	}
+
+	h, err := New(context.Background(), http.HandlerFunc(next), cfg, "simplecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := h.(*Cache)
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/vary-purge", nil)
+	req.Header.Set("Accept-Language", "en")
+	c.ServeHTTP(httptest.NewRecorder(), req)
+
+	key := c.cacheKey(req)
+	varyKey := varyActualKey(key, []string{"Accept-Language"}, req.Header)
+
+	if _, ok := c.store.Get(varyKey); !ok {
+		t.Fatal("expected Vary sub-entry to be stored")
+	}
+
+	rw := httptest.NewRecorder()
+	c.ServeHTTP(rw, httptest.NewRequest(methodPurge, "http://localhost/cache-admin/keys/"+key, nil))
+
+	if rw.Code != http.StatusNoContent {
+		t.Fatalf("unexpected purge status: %d", rw.Code)
+	}
+
+	if _, ok := c.store.Get(varyKey); ok {
+		t.Errorf("purging the base key left a Vary sub-entry behind")
+	}
+}
+
 func createTempDir(tb testing.TB) string {
 	tb.Helper()
 
@@ -0,0 +1,124 @@
+package plugin_simplecache
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// noMaxAge is the sentinel used for a max-age-style directive that was not
+// present in the header being parsed.
+const noMaxAge = -1
+
+// cacheControl holds the directives relevant to this plugin, parsed out of a
+// Cache-Control header. It is used for both request and response headers;
+// directives absent from the header are left false, or noMaxAge for the
+// numeric ones.
+type cacheControl struct {
+	NoStore        bool
+	NoCache        bool
+	Private        bool
+	Public         bool
+	MustRevalidate bool
+	MaxAge         int
+	SMaxAge        int
+	MaxStale       int
+	MaxStaleSet    bool
+	MinFresh       int
+
+	// StaleWhileRevalidate and StaleIfError are the RFC 5861 extensions: how
+	// long, past the freshness lifetime, a response may still be served
+	// while a fresh copy is fetched in the background, or while the
+	// upstream is erroring.
+	StaleWhileRevalidate int
+	StaleIfError         int
+}
+
+func parseCacheControl(header string) cacheControl {
+	cc := cacheControl{
+		MaxAge:               noMaxAge,
+		SMaxAge:              noMaxAge,
+		MaxStale:             noMaxAge,
+		MinFresh:             noMaxAge,
+		StaleWhileRevalidate: noMaxAge,
+		StaleIfError:         noMaxAge,
+	}
+
+	if header == "" {
+		return cc
+	}
+
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, value, _ := strings.Cut(part, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+
+		switch name {
+		case "no-store":
+			cc.NoStore = true
+		case "no-cache":
+			cc.NoCache = true
+		case "private":
+			cc.Private = true
+		case "public":
+			cc.Public = true
+		case "must-revalidate", "proxy-revalidate":
+			cc.MustRevalidate = true
+		case "max-age":
+			cc.MaxAge = parseSeconds(value)
+		case "s-maxage":
+			cc.SMaxAge = parseSeconds(value)
+		case "max-stale":
+			cc.MaxStaleSet = true
+			if value == "" {
+				// Bare "max-stale" accepts a response of any staleness. The
+				// value stays small enough to convert to a time.Duration in
+				// seconds without overflowing.
+				cc.MaxStale = math.MaxInt32
+			} else {
+				cc.MaxStale = parseSeconds(value)
+			}
+		case "min-fresh":
+			cc.MinFresh = parseSeconds(value)
+		case "stale-while-revalidate":
+			cc.StaleWhileRevalidate = parseSeconds(value)
+		case "stale-if-error":
+			cc.StaleIfError = parseSeconds(value)
+		}
+	}
+
+	return cc
+}
+
+// parseSeconds parses a delta-seconds value as used by max-age, s-maxage,
+// max-stale and min-fresh. An invalid or missing value yields noMaxAge so it
+// is treated as if the directive were absent.
+func parseSeconds(value string) int {
+	if value == "" {
+		return noMaxAge
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return noMaxAge
+	}
+
+	return seconds
+}
+
+// pragmaNoCache reports whether a legacy HTTP/1.0 "Pragma: no-cache" request
+// header is present.
+func pragmaNoCache(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		if strings.EqualFold(strings.TrimSpace(part), "no-cache") {
+			return true
+		}
+	}
+
+	return false
+}
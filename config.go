@@ -0,0 +1,88 @@
+package plugin_simplecache
+
+// Config the plugin configuration.
+type Config struct {
+	Path             string `json:"path" yaml:"path"`
+	MaxExpiry        int64  `json:"maxExpiry" yaml:"maxExpiry"`
+	Cleanup          int64  `json:"cleanup" yaml:"cleanup"`
+	AddStatusHeader  bool   `json:"addStatusHeader" yaml:"addStatusHeader"`
+	ConsiderUrlQuery bool   `json:"considerUrlQuery" yaml:"considerUrlQuery"`
+
+	Storage StorageConfig `json:"storage" yaml:"storage"`
+
+	// CacheKey is a template for the cache key, e.g.
+	// "{method}|{scheme}://{host}{path}?{query}|{header:Accept-Encoding}".
+	// Supported placeholders: {method}, {scheme}, {host}, {path}, {query}
+	// and {header:Name}. Leave empty to use the legacy
+	// method+host+path(+query) key.
+	CacheKey string `json:"cacheKey" yaml:"cacheKey"`
+
+	// IgnoreQueryParams and AllowQueryParams control which URL query
+	// parameters feed into {query} (and the legacy ConsiderUrlQuery key).
+	// A trailing "*" matches by prefix, e.g. "utm_*". AllowQueryParams, if
+	// non-empty, takes precedence and makes every other parameter ignored.
+	IgnoreQueryParams []string `json:"ignoreQueryParams" yaml:"ignoreQueryParams"`
+	AllowQueryParams  []string `json:"allowQueryParams" yaml:"allowQueryParams"`
+
+	// SurrogateKeyHeader is the upstream response header listing whitespace
+	// separated tags an entry should be purgeable by. Defaults to
+	// "Surrogate-Key".
+	SurrogateKeyHeader string `json:"surrogateKeyHeader" yaml:"surrogateKeyHeader"`
+
+	// Admin configures the plugin's own purge/stats endpoint. It's disabled
+	// (Path == "") unless explicitly set.
+	Admin AdminConfig `json:"admin" yaml:"admin"`
+
+	// CacheableMethods lists the HTTP methods this plugin will look up and
+	// populate the cache for. Defaults to ["GET", "HEAD"]. Adding "POST"
+	// opts into caching POST responses that explicitly mark themselves
+	// public and given a max-age (see MaxPostBodyBytes).
+	CacheableMethods []string `json:"cacheableMethods" yaml:"cacheableMethods"`
+
+	// MaxPostBodyBytes caps how much of a POST request body is hashed into
+	// its cache key; bodies larger than this are never cached. Defaults to
+	// 64KiB.
+	MaxPostBodyBytes int64 `json:"maxPostBodyBytes" yaml:"maxPostBodyBytes"`
+
+	// EnableETag synthesizes a weak ETag from the response body for entries
+	// stored without one of their own, so later requests bearing
+	// If-None-Match/If-Modified-Since can be answered with 304 Not Modified
+	// straight from the cache, without calling next.
+	EnableETag bool `json:"enableETag" yaml:"enableETag"`
+}
+
+// AdminConfig controls the admin endpoint mounted by Cache for out-of-band
+// invalidation: PURGE {Path}/keys/{key}, PURGE {Path}/tags/{tag} and GET
+// {Path}/stats.
+type AdminConfig struct {
+	Path  string `json:"path" yaml:"path"`
+	Token string `json:"token" yaml:"token"`
+}
+
+// StorageConfig selects and configures the backend entries are cached in.
+// Type defaults to "file", storing entries under Path; the other blocks are
+// only consulted when Type selects them.
+//
+// A Redis (or other network) backend isn't offered here: Traefik loads this
+// plugin through Yaegi, which only interprets the standard library, so a
+// backend wrapping a compiled third-party client couldn't actually load in
+// production. Sharing a cache across instances needs either a vendored,
+// manifest-declared dependency or a stdlib-only client, which is a bigger
+// change than this plugin takes on today.
+type StorageConfig struct {
+	Type   string              `json:"type" yaml:"type"`
+	Memory MemoryStorageConfig `json:"memory" yaml:"memory"`
+}
+
+// MemoryStorageConfig configures the in-memory LRU backend.
+type MemoryStorageConfig struct {
+	MaxBytes int64 `json:"maxBytes" yaml:"maxBytes"`
+}
+
+// CreateConfig creates and initializes the plugin configuration.
+func CreateConfig() *Config {
+	return &Config{
+		MaxExpiry: 300,
+		Cleanup:   600,
+	}
+}
@@ -0,0 +1,72 @@
+package plugin_simplecache
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// synthesizeETag derives a weak ETag from body, for responses that didn't
+// send one of their own, so later hits can still be revalidated with
+// If-None-Match. It's marked weak because the hash covers only the body,
+// not headers that might also affect equivalence.
+func synthesizeETag(body []byte) string {
+	sum := sha1.Sum(body)
+	return fmt.Sprintf(`W/"sha1-%x-%d"`, sum, len(body))
+}
+
+// conditionalHit reports whether req's own validators are satisfied by e,
+// meaning the cache can answer 304 Not Modified without calling next.
+// If-None-Match takes precedence over If-Modified-Since, per RFC 7232
+// Section 3.3.
+func conditionalHit(req *http.Request, e *entry) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, e.ETag)
+	}
+
+	if req.Header.Get("If-Modified-Since") != "" {
+		return notModifiedSince(req, e)
+	}
+
+	return false
+}
+
+// etagMatches reports whether etag satisfies any entry of the
+// comma-separated If-None-Match list, comparing weakly since a synthesized
+// ETag is always weak.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || weakETag(candidate) == weakETag(etag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func weakETag(s string) string {
+	return strings.TrimPrefix(s, "W/")
+}
+
+// notModifiedSince reports whether e's Last-Modified is no later than req's
+// If-Modified-Since.
+func notModifiedSince(req *http.Request, e *entry) bool {
+	if e.LastModified == "" {
+		return false
+	}
+
+	since := parseHTTPDate(req.Header.Get("If-Modified-Since"))
+	lastModified := parseHTTPDate(e.LastModified)
+
+	if since.IsZero() || lastModified.IsZero() {
+		return false
+	}
+
+	return !lastModified.After(since)
+}
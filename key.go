@@ -0,0 +1,139 @@
+package plugin_simplecache
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// cacheKey derives the storage key for req, as if it had req.Method.
+func (c *Cache) cacheKey(req *http.Request) string {
+	return c.cacheKeyMethod(req, req.Method)
+}
+
+// cacheKeyMethod derives the storage key for req under method, letting
+// callers look up or store a request under a different method's key — e.g.
+// HEAD shares GET's entry. If keyTemplate is set it's rendered against req;
+// otherwise the legacy method+host+path key is used, optionally suffixed
+// with the filtered query string when considerUrlQuery is set.
+func (c *Cache) cacheKeyMethod(req *http.Request, method string) string {
+	query := filteredQuery(req, c.ignoreQueryParams, c.allowQueryParams)
+
+	if c.keyTemplate != "" {
+		return renderCacheKey(c.keyTemplate, req, method, query)
+	}
+
+	if !c.considerUrlQuery || query == "" {
+		return method + req.Host + req.URL.Path
+	}
+
+	return method + req.Host + req.URL.Path + "?" + query
+}
+
+// renderCacheKey expands {method}, {scheme}, {host}, {path}, {query} and
+// {header:Name} placeholders in tmpl against req, substituting method for
+// req.Method.
+func renderCacheKey(tmpl string, req *http.Request, method, query string) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(tmpl); {
+		if tmpl[i] != '{' {
+			sb.WriteByte(tmpl[i])
+			i++
+			continue
+		}
+
+		end := strings.IndexByte(tmpl[i:], '}')
+		if end == -1 {
+			sb.WriteString(tmpl[i:])
+			break
+		}
+
+		sb.WriteString(resolvePlaceholder(tmpl[i+1:i+end], req, method, query))
+		i += end + 1
+	}
+
+	return sb.String()
+}
+
+func resolvePlaceholder(token string, req *http.Request, method, query string) string {
+	if name, ok := strings.CutPrefix(token, "header:"); ok {
+		return req.Header.Get(name)
+	}
+
+	switch token {
+	case "method":
+		return method
+	case "scheme":
+		return requestScheme(req)
+	case "host":
+		return req.Host
+	case "path":
+		return req.URL.Path
+	case "query":
+		return query
+	default:
+		return ""
+	}
+}
+
+func requestScheme(req *http.Request) string {
+	if req.TLS != nil {
+		return "https"
+	}
+
+	if proto := req.Header.Get("X-Forwarded-Proto"); proto != "" {
+		return proto
+	}
+
+	return "http"
+}
+
+// filteredQuery renders req's query string as a sorted "k=v&k=v" list,
+// dropping parameters per ignore/allow. allow, if non-empty, takes
+// precedence: only listed parameters are kept. Otherwise every parameter is
+// kept except those matched by ignore. A pattern ending in "*" matches by
+// prefix (e.g. "utm_*").
+func filteredQuery(req *http.Request, ignore, allow []string) string {
+	values := req.URL.Query()
+	if len(values) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		if queryParamAllowed(k, ignore, allow) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+strings.Join(values[k], ","))
+	}
+
+	return strings.Join(parts, "&")
+}
+
+func queryParamAllowed(name string, ignore, allow []string) bool {
+	if len(allow) > 0 {
+		return matchesAnyParam(allow, name)
+	}
+
+	return !matchesAnyParam(ignore, name)
+}
+
+func matchesAnyParam(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if p == name {
+			return true
+		}
+	}
+
+	return false
+}
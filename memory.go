@@ -0,0 +1,166 @@
+package plugin_simplecache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryStore is an in-memory Storage backed by an LRU list, capped at
+// maxBytes of entry bodies plus header names and values (0 means unbounded). It's useful for
+// single-instance deployments that don't want disk I/O on the hot path.
+type memoryStore struct {
+	mu       sync.Mutex
+	maxBytes int64
+	curBytes int64
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type memoryItem struct {
+	key   string
+	entry *entry
+}
+
+func newMemoryStore(maxBytes int64) *memoryStore {
+	return &memoryStore{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (m *memoryStore) Get(key string) (*entry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	m.ll.MoveToFront(el)
+
+	return el.Value.(*memoryItem).entry, true
+}
+
+func (m *memoryStore) Set(key string, e *entry) error {
+	e.Key = key
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		m.curBytes -= entrySize(el.Value.(*memoryItem).entry)
+		el.Value = &memoryItem{key: key, entry: e}
+		m.ll.MoveToFront(el)
+	} else {
+		m.items[key] = m.ll.PushFront(&memoryItem{key: key, entry: e})
+	}
+
+	m.curBytes += entrySize(e)
+	m.evict()
+
+	return nil
+}
+
+func (m *memoryStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deleteLocked(key)
+
+	return nil
+}
+
+func (m *memoryStore) deleteLocked(key string) {
+	el, ok := m.items[key]
+	if !ok {
+		return
+	}
+
+	m.curBytes -= entrySize(el.Value.(*memoryItem).entry)
+	m.ll.Remove(el)
+	delete(m.items, key)
+}
+
+func (m *memoryStore) Purge(prefix string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key := range m.items {
+		if strings.HasPrefix(key, prefix) {
+			m.deleteLocked(key)
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStore) Iterate(fn func(key string, e *entry) bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for el := m.ll.Front(); el != nil; el = el.Next() {
+		item := el.Value.(*memoryItem)
+		if !fn(item.key, item.entry) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// evict drops entries from the back of the LRU until curBytes is within
+// maxBytes. Must be called with m.mu held. A zero maxBytes disables the cap.
+func (m *memoryStore) evict() {
+	if m.maxBytes <= 0 {
+		return
+	}
+
+	for m.curBytes > m.maxBytes {
+		el := m.ll.Back()
+		if el == nil {
+			return
+		}
+
+		m.deleteLocked(el.Value.(*memoryItem).key)
+	}
+}
+
+// cleanupExpired drops entries that are expired outright, independent of
+// the LRU byte cap, so long-idle keys don't linger just because there's
+// room for them. Vary-name markers are skipped: they carry no freshness
+// fields of their own and aren't subject to expiry.
+func (m *memoryStore) cleanupExpired(maxExpiry time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var stale []string
+	for el := m.ll.Front(); el != nil; el = el.Next() {
+		item := el.Value.(*memoryItem)
+		if !isVaryRecordKey(item.key) && isExpired(item.entry, maxExpiry) {
+			stale = append(stale, item.key)
+		}
+	}
+
+	for _, key := range stale {
+		m.deleteLocked(key)
+	}
+
+	return nil
+}
+
+func entrySize(e *entry) int64 {
+	size := int64(len(e.Body))
+
+	for k, values := range e.Header {
+		size += int64(len(k))
+		for _, v := range values {
+			size += int64(len(v))
+		}
+	}
+
+	return size
+}
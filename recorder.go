@@ -0,0 +1,33 @@
+package plugin_simplecache
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// responseRecorder captures next's response so it can be inspected for
+// cacheability before being written to the real ResponseWriter.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{
+		header: make(http.Header),
+		status: http.StatusOK,
+	}
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+}
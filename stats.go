@@ -0,0 +1,35 @@
+package plugin_simplecache
+
+import "sync/atomic"
+
+// cacheStats are the hit/miss counters surfaced by the admin stats endpoint.
+// The zero value is ready to use.
+type cacheStats struct {
+	hits        int64
+	stale       int64
+	revalidated int64
+	misses      int64
+}
+
+// record tallies a Cache-Status value as produced by serveEntry/writeAndStore.
+func (s *cacheStats) record(status string) {
+	switch status {
+	case "hit":
+		atomic.AddInt64(&s.hits, 1)
+	case "hit; stale":
+		atomic.AddInt64(&s.stale, 1)
+	case "revalidated":
+		atomic.AddInt64(&s.revalidated, 1)
+	case "miss":
+		atomic.AddInt64(&s.misses, 1)
+	}
+}
+
+func (s *cacheStats) snapshot() map[string]int64 {
+	return map[string]int64{
+		"hits":        atomic.LoadInt64(&s.hits),
+		"stale":       atomic.LoadInt64(&s.stale),
+		"revalidated": atomic.LoadInt64(&s.revalidated),
+		"misses":      atomic.LoadInt64(&s.misses),
+	}
+}
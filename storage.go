@@ -0,0 +1,211 @@
+package plugin_simplecache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// errStopIteration is used internally to unwind filepath.Walk once a caller
+// of Iterate has seen enough.
+var errStopIteration = errors.New("stop iteration")
+
+// Storage is the persistence layer Cache stores entries in. Implementations
+// must be safe for concurrent use.
+type Storage interface {
+	Get(key string) (*entry, bool)
+	Set(key string, e *entry) error
+	Delete(key string) error
+	// Purge removes every entry whose key starts with prefix.
+	Purge(prefix string) error
+	// Iterate calls fn for every stored entry, stopping early if fn returns
+	// false.
+	Iterate(fn func(key string, e *entry) bool) error
+}
+
+// newStorage builds the Storage backend selected by cfg.
+func newStorage(cfg *Config) (Storage, error) {
+	switch cfg.Storage.Type {
+	case "", "file":
+		return newFileStore(cfg.Path)
+	case "memory":
+		return newMemoryStore(cfg.Storage.Memory.MaxBytes), nil
+	default:
+		return nil, &unknownStorageError{cfg.Storage.Type}
+	}
+}
+
+type unknownStorageError struct{ storageType string }
+
+func (e *unknownStorageError) Error() string {
+	return "simplecache: unknown storage type " + strings.TrimSpace(e.storageType)
+}
+
+// entry is the persisted representation of a cached response, including the
+// bits of RFC 7234 bookkeeping needed to judge freshness and revalidate it
+// later on.
+type entry struct {
+	// Key is the cache key this entry was stored under. Backends that can't
+	// derive it back from their own storage key (e.g. a hashed filename)
+	// keep it here so Purge and Iterate can match against it.
+	Key string
+
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+
+	// Date is the response's own Date header, falling back to StoredAt when
+	// the upstream didn't send one.
+	Date time.Time
+	// StoredAt is the local wall-clock time the entry was written.
+	StoredAt time.Time
+	// InitialAge is the value of the upstream's Age header, if any, at the
+	// time the entry was stored.
+	InitialAge int
+
+	MaxAge         int
+	SMaxAge        int
+	NoCache        bool
+	MustRevalidate bool
+	Expires        time.Time
+
+	// StaleWhileRevalidate and StaleIfError mirror the RFC 5861 directives
+	// from the response that produced this entry; -1 means absent.
+	StaleWhileRevalidate int
+	StaleIfError         int
+
+	ETag         string
+	LastModified string
+	Vary         string
+
+	// Tags are the surrogate keys this entry was published under, parsed
+	// from the configured surrogate-key response header, for bulk purging.
+	Tags []string
+}
+
+// fileStore persists entries as gob-encoded files named after the sha256 of
+// their key, under Path.
+type fileStore struct {
+	path string
+}
+
+func newFileStore(path string) (*fileStore, error) {
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &fileStore{path: path}, nil
+}
+
+func (f *fileStore) filename(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(f.path, hex.EncodeToString(sum[:]))
+}
+
+func (f *fileStore) Get(key string) (*entry, bool) {
+	data, err := os.ReadFile(f.filename(key))
+	if err != nil {
+		return nil, false
+	}
+
+	var e entry
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&e); err != nil {
+		return nil, false
+	}
+
+	return &e, true
+}
+
+func (f *fileStore) Set(key string, e *entry) error {
+	e.Key = key
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+		return err
+	}
+
+	return os.WriteFile(f.filename(key), buf.Bytes(), 0o644)
+}
+
+func (f *fileStore) Delete(key string) error {
+	err := os.Remove(f.filename(key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (f *fileStore) Purge(prefix string) error {
+	return f.Iterate(func(key string, e *entry) bool {
+		if strings.HasPrefix(key, prefix) {
+			_ = f.Delete(key)
+		}
+		return true
+	})
+}
+
+func (f *fileStore) Iterate(fn func(key string, e *entry) bool) error {
+	err := filepath.Walk(f.path, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil
+		}
+
+		var e entry
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&e); err != nil {
+			return nil
+		}
+
+		if !fn(e.Key, &e) {
+			return errStopIteration
+		}
+
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, errStopIteration) {
+		return err
+	}
+
+	return nil
+}
+
+// cleanupExpired walks the store and removes every entry whose freshness
+// lifetime (plus the longer of maxExpiry and its stale-serving window) has
+// elapsed. It's invoked periodically from Cache's background goroutine.
+// Vary-name markers are skipped: they carry no freshness fields of their
+// own and aren't subject to expiry.
+func (f *fileStore) cleanupExpired(maxExpiry time.Duration) error {
+	return f.Iterate(func(key string, e *entry) bool {
+		if !isVaryRecordKey(key) && isExpired(e, maxExpiry) {
+			_ = f.Delete(key)
+		}
+		return true
+	})
+}
+
+// isExpired reports whether e is old enough that it's no longer worth
+// keeping around at all, even for stale-while-revalidate/stale-if-error
+// purposes.
+func isExpired(e *entry, maxExpiry time.Duration) bool {
+	age := time.Since(e.StoredAt) + time.Duration(e.InitialAge)*time.Second
+
+	extra := maxExpiry
+	if d := staleExtension(e); d > extra {
+		extra = d
+	}
+
+	return age > freshnessLifetime(e, maxExpiry)+extra
+}
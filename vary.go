@@ -0,0 +1,97 @@
+package plugin_simplecache
+
+import (
+	"net/http"
+	"strings"
+)
+
+// varyRecordSuffix marks the storage key holding the set of request headers
+// a resource varies on. It can't collide with a real cache key because NUL
+// never appears in one.
+const varyRecordSuffix = "\x00vary"
+
+// parseVary splits a Vary response header into canonicalized header names.
+// A bare "*" (meaning the response can never be matched from cache again)
+// is reported as nil, same as an absent header; callers that care about the
+// distinction should check varyIsWildcard separately.
+func parseVary(header string) []string {
+	if header == "" || varyIsWildcard(header) {
+		return nil
+	}
+
+	var names []string
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			names = append(names, http.CanonicalHeaderKey(part))
+		}
+	}
+
+	return names
+}
+
+// isVaryRecordKey reports whether key names a Vary-name marker rather than
+// an actual cache entry, so callers that walk every stored key (stats,
+// expiry sweeps) can exclude it.
+func isVaryRecordKey(key string) bool {
+	return strings.HasSuffix(key, varyRecordSuffix)
+}
+
+func varyIsWildcard(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		if strings.TrimSpace(part) == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// varyActualKey derives the storage key for a request given the base key
+// and the set of headers the resource is known to vary on.
+func varyActualKey(base string, names []string, header http.Header) string {
+	if len(names) == 0 {
+		return base
+	}
+
+	var sb strings.Builder
+	sb.WriteString(base)
+	sb.WriteString("|vary")
+
+	for _, name := range names {
+		sb.WriteByte('|')
+		sb.WriteString(name)
+		sb.WriteByte('=')
+		sb.WriteString(header.Get(name))
+	}
+
+	return sb.String()
+}
+
+// lookupVaryNames returns the header names previously recorded as this
+// resource's Vary set, if any.
+func (c *Cache) lookupVaryNames(base string) []string {
+	e, ok := c.store.Get(base + varyRecordSuffix)
+	if !ok || len(e.Body) == 0 {
+		return nil
+	}
+
+	return strings.Split(string(e.Body), ",")
+}
+
+func (c *Cache) storeVaryNames(base string, names []string) {
+	_ = c.store.Set(base+varyRecordSuffix, &entry{Body: []byte(strings.Join(names, ","))})
+}
+
+// resolveStoreKey determines the key a freshly-fetched response should be
+// stored under, recording its Vary header for future lookups if present.
+func (c *Cache) resolveStoreKey(base string, req *http.Request, varyHeader string) string {
+	names := parseVary(varyHeader)
+	if len(names) == 0 {
+		return base
+	}
+
+	c.storeVaryNames(base, names)
+
+	return varyActualKey(base, names, req.Header)
+}